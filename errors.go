@@ -0,0 +1,257 @@
+package errors
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+)
+
+// New returns an error with the supplied message and a stack trace captured
+// at the point New was called.
+func New(message string) error {
+	return &fundamental{
+		msg:   message,
+		stack: callers(0),
+	}
+}
+
+// Errorf formats according to a format specifier and returns the string as a
+// value that satisfies error, with a stack trace captured at the point
+// Errorf was called.
+func Errorf(format string, args ...interface{}) error {
+	return &fundamental{
+		msg:   fmt.Sprintf(format, args...),
+		stack: callers(0),
+	}
+}
+
+// fundamental is an error that has a message and a stack, but no cause.
+type fundamental struct {
+	msg string
+	*stack
+}
+
+func (f *fundamental) Error() string { return f.msg }
+
+func (f *fundamental) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			io.WriteString(s, f.msg)
+			f.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, f.msg)
+	case 'q':
+		fmt.Fprintf(s, "%q", f.msg)
+	}
+}
+
+// MarshalJSON implements json.Marshaler, emitting the error's message and
+// stack trace for structured loggers.
+func (f *fundamental) MarshalJSON() ([]byte, error) {
+	return marshalErrorJSON(f, f.StackTrace())
+}
+
+// WithStack annotates err with a stack trace at the point WithStack was
+// called. If err is nil, WithStack returns nil.
+func WithStack(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &withStack{
+		error: err,
+		stack: callers(0),
+	}
+}
+
+// withStack annotates an error with a stack trace at the point it was
+// wrapped, without changing the error's message.
+type withStack struct {
+	error
+	*stack
+}
+
+func (w *withStack) Cause() error  { return w.error }
+func (w *withStack) Unwrap() error { return w.error }
+
+func (w *withStack) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v", w.Cause())
+			w.stack.Format(s, verb)
+			return
+		}
+		fallthrough
+	case 's':
+		io.WriteString(s, w.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", w.Error())
+	}
+}
+
+// MarshalJSON implements json.Marshaler, emitting the error's message, stack
+// trace, and (if present) the wrapped cause.
+func (w *withStack) MarshalJSON() ([]byte, error) {
+	return marshalErrorJSON(w, w.StackTrace())
+}
+
+// WithMessage annotates err with a new message. If err is nil, WithMessage
+// returns nil.
+func WithMessage(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	return &withMessage{
+		cause: err,
+		msg:   message,
+	}
+}
+
+// WithMessagef annotates err with the format specifier. If err is nil,
+// WithMessagef returns nil.
+func WithMessagef(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &withMessage{
+		cause: err,
+		msg:   fmt.Sprintf(format, args...),
+	}
+}
+
+// withMessage annotates an error with a message, but carries no stack of its
+// own.
+type withMessage struct {
+	cause error
+	msg   string
+}
+
+func (w *withMessage) Error() string { return w.msg + ": " + w.cause.Error() }
+func (w *withMessage) Cause() error  { return w.cause }
+func (w *withMessage) Unwrap() error { return w.cause }
+
+func (w *withMessage) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprintf(s, "%+v\n", w.Cause())
+			io.WriteString(s, w.msg)
+			return
+		}
+		fallthrough
+	case 's', 'q':
+		io.WriteString(s, w.Error())
+	}
+}
+
+// Wrap returns an error annotating err with a message and a stack trace at
+// the point Wrap is called. If err is nil, Wrap returns nil.
+func Wrap(err error, message string) error {
+	if err == nil {
+		return nil
+	}
+	err = &withMessage{cause: err, msg: message}
+	return &withStack{error: err, stack: callers(0)}
+}
+
+// Wrapf returns an error annotating err with a message and a stack trace at
+// the point Wrapf is called. If err is nil, Wrapf returns nil.
+func Wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	err = &withMessage{cause: err, msg: fmt.Sprintf(format, args...)}
+	return &withStack{error: err, stack: callers(0)}
+}
+
+// causer is implemented by errors that can be unwrapped to an underlying
+// cause, predating the standard library's errors.Unwrap convention.
+type causer interface {
+	Cause() error
+}
+
+// Cause returns the underlying cause of the error, if possible. An error
+// value has a cause if it implements the causer interface.
+//
+// If the error does not implement Cause, the original error will be
+// returned. If the error is nil, nil will be returned without further
+// investigation.
+func Cause(err error) error {
+	for err != nil {
+		cause, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+	return err
+}
+
+// errorJSON is the shape MarshalJSON produces for a stack-carrying error: its
+// message, the stack captured at the point it was created (if any), and the
+// wrapped cause (if any), walked via errors.Unwrap.
+type errorJSON struct {
+	Message string      `json:"message"`
+	Cause   *errorJSON  `json:"cause,omitempty"`
+	Stack   []FrameInfo `json:"stack,omitempty"`
+}
+
+// marshalErrorJSON builds and encodes the errorJSON payload for err, whose
+// own stack trace (if it carries one) is ownStack.
+func marshalErrorJSON(err error, ownStack StackTrace) ([]byte, error) {
+	return json.Marshal(toErrorJSON(err, ownStack))
+}
+
+// toErrorJSON walks err's wrap chain via errors.Unwrap, building the nested
+// payload described on errorJSON.
+//
+// Wrap and Wrapf build a *withStack wrapping a *withMessage: together they
+// represent one logical annotation, the message Wrap added captured
+// alongside the stack at the point Wrap was called. Without collapsing that
+// pair into a single node, the *withStack would report the cumulative
+// "msg: cause" text from Error() and its *withMessage child would then
+// report the same annotation again, duplicating it at two adjacent depths.
+func toErrorJSON(err error, ownStack StackTrace) *errorJSON {
+	if err == nil {
+		return nil
+	}
+
+	msg := ownMessage(err)
+	next := stderrors.Unwrap(err)
+	if ws, ok := err.(*withStack); ok {
+		if wm, ok := ws.error.(*withMessage); ok {
+			msg = wm.msg
+			next = wm.cause
+		}
+	}
+
+	ej := &errorJSON{Message: msg}
+	if len(ownStack) > 0 {
+		ej.Stack = ownStack.Frames()
+	}
+	if next != nil {
+		var nextStack StackTrace
+		if st, ok := next.(stackTracer); ok {
+			nextStack = st.StackTrace()
+		}
+		ej.Cause = toErrorJSON(next, nextStack)
+	}
+	return ej
+}
+
+// ownMessage returns the fragment of text err itself contributed, rather
+// than the cumulative message Error() produces. withMessage.Error() returns
+// "msg: <cause>", so without this special case every node in a Wrap chain
+// would repeat its cause's full text instead of showing just the annotation
+// it added.
+func ownMessage(err error) string {
+	if wm, ok := err.(*withMessage); ok {
+		return wm.msg
+	}
+	return err.Error()
+}
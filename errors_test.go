@@ -0,0 +1,72 @@
+package errors
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToErrorJSONOwnMessage(t *testing.T) {
+	err := Wrap(New("boom"), "wrapped")
+
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		t.Fatalf("json.Marshal returned error: %v", marshalErr)
+	}
+
+	var got struct {
+		Message string `json:"message"`
+		Cause   struct {
+			Message string `json:"message"`
+		} `json:"cause"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	// Wrap's withStack/withMessage pair collapses into a single node, so
+	// there are only two levels here: the annotation Wrap added, and the
+	// cause it wrapped.
+	if want := "wrapped"; got.Message != want {
+		t.Errorf("top-level message = %q, want %q", got.Message, want)
+	}
+	if want := "boom"; got.Cause.Message != want {
+		t.Errorf("cause message = %q, want %q", got.Cause.Message, want)
+	}
+}
+
+// TestToErrorJSONOwnMessageTwoLevels covers the case a single wrap can't
+// distinguish: with only one Wrap call, the "own fragment" and "cumulative"
+// interpretations of the top-level message happen to produce the same
+// depth, so a bug that duplicates the cumulative text one level down can
+// slip through undetected. Chaining two Wraps exposes it.
+func TestToErrorJSONOwnMessageTwoLevels(t *testing.T) {
+	err := Wrap(Wrap(New("boom"), "inner"), "outer")
+
+	data, marshalErr := json.Marshal(err)
+	if marshalErr != nil {
+		t.Fatalf("json.Marshal returned error: %v", marshalErr)
+	}
+
+	var got struct {
+		Message string `json:"message"`
+		Cause   struct {
+			Message string `json:"message"`
+			Cause   struct {
+				Message string `json:"message"`
+			} `json:"cause"`
+		} `json:"cause"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+
+	if want := "outer"; got.Message != want {
+		t.Errorf("top-level message = %q, want %q", got.Message, want)
+	}
+	if want := "inner"; got.Cause.Message != want {
+		t.Errorf("cause message = %q, want %q", got.Cause.Message, want)
+	}
+	if want := "boom"; got.Cause.Cause.Message != want {
+		t.Errorf("cause.cause message = %q, want %q", got.Cause.Cause.Message, want)
+	}
+}
@@ -0,0 +1,60 @@
+package errors
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoCapturesAndCleansUpOrigin(t *testing.T) {
+	const n = 20
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		Go(func() {
+			defer wg.Done()
+			errs[i] = New("boom")
+		})
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		st, ok := err.(stackTracer)
+		if !ok {
+			t.Fatalf("error %d does not implement stackTracer", i)
+		}
+		// The launching goroutine's stack should have been captured
+		// alongside the error's own stack.
+		s := err.(*fundamental).stack
+		if len(s.origin) == 0 {
+			t.Errorf("error %d: expected a captured goroutine origin, got none", i)
+		}
+		if len(st.StackTrace()) == 0 {
+			t.Errorf("error %d: expected a non-empty stack trace", i)
+		}
+	}
+
+	// Every registration made by Go above must have been cleaned up once its
+	// goroutine returned, or this leaks one entry per call forever. wg.Wait
+	// only shows that each fn has returned; Go's cleanup runs just after, so
+	// wait (bounded) for the goroutines themselves to finish.
+	deadline := time.Now().Add(time.Second)
+	for liveGoroutineOrigins.Load() != 0 && time.Now().Before(deadline) {
+		runtime.Gosched()
+	}
+	remaining := 0
+	goroutineOrigins.Range(func(key, value interface{}) bool {
+		remaining++
+		return true
+	})
+	if remaining != 0 {
+		t.Errorf("goroutineOrigins leaked %d entries after all goroutines completed", remaining)
+	}
+	if got := liveGoroutineOrigins.Load(); got != 0 {
+		t.Errorf("liveGoroutineOrigins = %d, want 0 after all goroutines completed", got)
+	}
+}
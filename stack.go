@@ -1,12 +1,16 @@
 package errors
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"path"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // Frame represents a program counter inside a stack frame.
@@ -18,35 +22,66 @@ type Frame uintptr
 // multiple frames may have the same PC value.
 func (f Frame) pc() uintptr { return uintptr(f) - 1 }
 
+// expandedFrame carries the metadata runtime.CallersFrames resolves for a
+// single program counter. Unlike runtime.FuncForPC, this is inline-aware: a
+// pc that was folded into its caller by the compiler still resolves to the
+// function, file, and line it actually came from.
+type expandedFrame struct {
+	Function string
+	File     string
+	Line     int
+	Entry    uintptr
+}
+
+// frameCache memoizes expandPC lookups, keyed by raw pc, so repeated %v/%s/%n
+// formatting of the same Frame doesn't re-walk runtime.CallersFrames.
+var frameCache sync.Map // map[uintptr]expandedFrame
+
+// expandPC resolves the metadata for a single program counter via
+// runtime.CallersFrames, which correctly accounts for inlined functions.
+func expandPC(pc uintptr) expandedFrame {
+	if v, ok := frameCache.Load(pc); ok {
+		return v.(expandedFrame)
+	}
+	frames := runtime.CallersFrames([]uintptr{pc})
+	frame, _ := frames.Next()
+	ef := expandedFrame{
+		Function: frame.Function,
+		File:     frame.File,
+		Line:     frame.Line,
+		Entry:    frame.Entry,
+	}
+	frameCache.Store(pc, ef)
+	return ef
+}
+
 // file returns the full path to the file that contains the
 // function for this Frame's pc.
 func (f Frame) file() string {
-	fn := runtime.FuncForPC(f.pc())
-	if fn == nil {
+	ef := expandPC(f.pc())
+	if ef.Function == "" {
 		return "unknown"
 	}
-	file, _ := fn.FileLine(f.pc())
-	return file
+	return ef.File
 }
 
 // line returns the line number of source code of the
 // function for this Frame's pc.
 func (f Frame) line() int {
-	fn := runtime.FuncForPC(f.pc())
-	if fn == nil {
+	ef := expandPC(f.pc())
+	if ef.Function == "" {
 		return 0
 	}
-	_, line := fn.FileLine(f.pc())
-	return line
+	return ef.Line
 }
 
 // name returns the name of this function, if known.
 func (f Frame) name() string {
-	fn := runtime.FuncForPC(f.pc())
-	if fn == nil {
+	ef := expandPC(f.pc())
+	if ef.Function == "" {
 		return "unknown"
 	}
-	return fn.Name()
+	return ef.Function
 }
 
 // Format formats the frame according to the fmt.Formatter interface.
@@ -54,12 +89,15 @@ func (f Frame) name() string {
 //	%s    source file
 //	%d    source line
 //	%n    function name
+//	%k    last path segment of the function's package
 //	%v    equivalent to %s:%d
 //
 // Format accepts flags that alter the printing of some verbs, as follows:
 //
 //	%+s   function name and path of source file relative to the compile time
 //	      GOPATH separated by \n\t (<funcname>\n\t<path>)
+//	%+n   fully-qualified <pkg>.<func> name, package and receiver included
+//	%+k   full import path of the function's package
 //	%+v   equivalent to %+s:%d
 func (f Frame) Format(s fmt.State, verb rune) {
 	switch verb {
@@ -75,7 +113,20 @@ func (f Frame) Format(s fmt.State, verb rune) {
 	case 'd':
 		io.WriteString(s, strconv.Itoa(f.line()))
 	case 'n':
-		io.WriteString(s, funcname(f.name()))
+		switch {
+		case s.Flag('+'):
+			io.WriteString(s, f.name())
+		default:
+			io.WriteString(s, funcname(f.name()))
+		}
+	case 'k':
+		pkg, _ := splitFuncName(f.name())
+		switch {
+		case s.Flag('+'):
+			io.WriteString(s, pkg)
+		default:
+			io.WriteString(s, path.Base(pkg))
+		}
 	case 'v':
 		f.Format(s, 's')
 		io.WriteString(s, ":")
@@ -93,6 +144,47 @@ func (f Frame) MarshalText() ([]byte, error) {
 	return []byte(fmt.Sprintf("%s %s:%d", name, f.file(), f.line())), nil
 }
 
+// FrameInfo is a plain, JSON-friendly snapshot of a Frame's resolved
+// metadata, for callers that want to build their own structured log payloads
+// without going through fmt.
+type FrameInfo struct {
+	Function string `json:"func"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Package  string `json:"package"`
+}
+
+// info builds the FrameInfo for this Frame.
+func (f Frame) info() FrameInfo {
+	pkg, fn := splitFuncName(f.name())
+	short := path.Base(pkg)
+	function := short
+	if fn != "" {
+		function = short + "." + fn
+	}
+	return FrameInfo{
+		Function: function,
+		File:     f.file(),
+		Line:     f.line(),
+		Package:  short,
+	}
+}
+
+// splitFuncName splits a function's fully-qualified name, as reported by
+// runtime.Func.Name(), into its package import path and the function (or
+// method) name within that package. For example
+// "github.com/foo/bar.(*T).Method" splits into
+// ("github.com/foo/bar", "(*T).Method").
+func splitFuncName(name string) (pkg, fn string) {
+	slash := strings.LastIndex(name, "/")
+	rest := name[slash+1:]
+	dot := strings.Index(rest, ".")
+	if dot < 0 {
+		return name, ""
+	}
+	return name[:slash+1+dot], rest[dot+1:]
+}
+
 // StackTrace is stack of Frames from innermost (newest) to outermost (oldest).
 type StackTrace []Frame
 
@@ -100,6 +192,8 @@ type StackTrace []Frame
 //
 //	%s	lists source files for each Frame in the stack
 //	%v	lists the source file and line number for each Frame in the stack
+//	%n	lists the function name for each Frame in the stack
+//	%k	lists the package name for each Frame in the stack
 //
 // Format accepts flags that alter the printing of some verbs, as follows:
 //
@@ -118,11 +212,124 @@ func (st StackTrace) Format(s fmt.State, verb rune) {
 		default:
 			st.formatSlice(s, verb)
 		}
-	case 's':
+	case 's', 'n', 'k':
 		st.formatSlice(s, verb)
 	}
 }
 
+// Frames returns a plain-struct snapshot of every Frame in the stack, in the
+// same innermost-first order as the StackTrace itself, so callers can build
+// their own structured payloads without going through fmt.
+func (st StackTrace) Frames() []FrameInfo {
+	frames := make([]FrameInfo, len(st))
+	for i, f := range st {
+		frames[i] = f.info()
+	}
+	return frames
+}
+
+// MarshalJSON implements json.Marshaler, encoding the stack as an array of
+// FrameInfo objects (innermost frame first) so structured loggers can attach
+// it directly to a log entry.
+func (st StackTrace) MarshalJSON() ([]byte, error) {
+	return json.Marshal(st.Frames())
+}
+
+// stackTracer is implemented by errors that carry a stack trace, such as the
+// values returned by New, Errorf, Wrap, and WithStack.
+type stackTracer interface {
+	StackTrace() StackTrace
+}
+
+// TrimRuntime returns a copy of the stack trace with the runtime and testing
+// bootstrap frames dropped from the outermost (oldest) end: runtime.goexit,
+// testing.tRunner, and runtime.main.
+func (st StackTrace) TrimRuntime() StackTrace {
+	end := len(st)
+	for end > 0 && isRuntimeBoundary(st[end-1]) {
+		end--
+	}
+	return append(StackTrace(nil), st[:end]...)
+}
+
+// isRuntimeBoundary reports whether f is one of the frames runtime/testing
+// use to bootstrap a goroutine, which TrimRuntime strips.
+func isRuntimeBoundary(f Frame) bool {
+	switch f.name() {
+	case "runtime.goexit", "testing.tRunner", "runtime.main":
+		return true
+	}
+	return false
+}
+
+// TrimBelow returns a copy of the stack trace with every frame below (older
+// than) the first frame matching pred removed; the matching frame itself is
+// kept. If no frame matches, an unmodified copy of st is returned.
+func (st StackTrace) TrimBelow(pred func(Frame) bool) StackTrace {
+	for i, f := range st {
+		if pred(f) {
+			return append(StackTrace(nil), st[:i+1]...)
+		}
+	}
+	return append(StackTrace(nil), st...)
+}
+
+// TrimAbove returns a copy of the stack trace with every frame above (newer
+// than) the first frame matching pred removed; the matching frame itself is
+// kept. If no frame matches, an unmodified copy of st is returned.
+func (st StackTrace) TrimAbove(pred func(Frame) bool) StackTrace {
+	for i, f := range st {
+		if pred(f) {
+			return append(StackTrace(nil), st[i:]...)
+		}
+	}
+	return append(StackTrace(nil), st...)
+}
+
+// Filter returns a copy of the stack trace containing only the frames for
+// which pred returns true.
+func (st StackTrace) Filter(pred func(Frame) bool) StackTrace {
+	var out StackTrace
+	for _, f := range st {
+		if pred(f) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// stackTrimmerMu guards stackTrimmer.
+var stackTrimmerMu sync.RWMutex
+
+// stackTrimmer is the global trimmer installed by SetStackTrimmer, if any.
+var stackTrimmer func(StackTrace) StackTrace
+
+// SetStackTrimmer installs a trimming function that callers() applies to
+// every captured stack trace before it's exposed to formatters, JSON
+// marshaling, or any other StackTrace-based API, so applications can
+// globally strip vendored middleware or test-runner noise from every trace
+// they capture. Pass nil to remove a previously installed trimmer.
+//
+// ancestorOfCause reads its own stack from the untrimmed program counters,
+// not through this trimmed view. The cause stack it is given is compared as
+// passed in, so a cause stack taken from StackTrace() is compared trimmed.
+func SetStackTrimmer(trim func(StackTrace) StackTrace) {
+	stackTrimmerMu.Lock()
+	defer stackTrimmerMu.Unlock()
+	stackTrimmer = trim
+}
+
+// applyStackTrimmer runs the globally installed trimmer, if any, over st.
+func applyStackTrimmer(st StackTrace) StackTrace {
+	stackTrimmerMu.RLock()
+	trim := stackTrimmer
+	stackTrimmerMu.RUnlock()
+	if trim == nil {
+		return st
+	}
+	return trim(st)
+}
+
 // formatSlice will format this StackTrace into the given buffer as a slice of
 // Frame, only valid when called with '%s' or '%v'.
 func (st StackTrace) formatSlice(s fmt.State, verb rune) {
@@ -136,28 +343,74 @@ func (st StackTrace) formatSlice(s fmt.State, verb rune) {
 	io.WriteString(s, "]")
 }
 
-// stack represents a stack of program counters.
-type stack []uintptr
+// stack represents a stack of program counters, plus, if it was captured
+// inside a goroutine started via Go, the stack of whatever launched that
+// goroutine.
+type stack struct {
+	pcs []uintptr
+
+	// origin is the launching goroutine's stack, captured by Go at the
+	// point it started this goroutine. Empty unless the current goroutine
+	// was started via Go.
+	origin []uintptr
+}
 
 func (s *stack) Format(st fmt.State, verb rune) {
 	switch verb {
 	case 'v':
 		switch {
 		case st.Flag('+'):
-			for _, pc := range *s {
-				f := Frame(pc)
+			for _, f := range s.StackTrace() {
 				fmt.Fprintf(st, "\n%+v", f)
 			}
+			if len(s.origin) > 0 {
+				io.WriteString(st, "\ncreated by goroutine at:")
+				for _, f := range expandStack(s.origin) {
+					fmt.Fprintf(st, "\n%+v", f)
+				}
+			}
 		}
 	}
 }
 
+// StackTrace expands the raw program counters into Frames via
+// runtime.CallersFrames, then applies the globally installed stack trimmer
+// (see SetStackTrimmer), if any. A single pc can unfold into several Frames
+// when the compiler inlined one or more calls into that return address, so
+// the resulting StackTrace may be longer than the underlying stack.
+//
+// The raw program counters in s are left untouched; internal logic that
+// needs the untrimmed stack, such as ancestorOfCause, should keep operating
+// on *stack directly rather than going through this trimmed view. The
+// launching goroutine's stack, if any, is not included here: it's only
+// surfaced by Format's "created by goroutine at:" section, since it belongs
+// to a different goroutine and would otherwise confuse frame-by-frame
+// comparisons like IsAncestor.
 func (s *stack) StackTrace() StackTrace {
-	f := make([]Frame, len(*s))
-	for i := 0; i < len(f); i++ {
-		f[i] = Frame((*s)[i])
+	return applyStackTrimmer(expandStack(s.pcs))
+}
+
+// expandStack expands a slice of raw program counters into Frames via
+// runtime.CallersFrames, with no trimming applied.
+func expandStack(pcs []uintptr) StackTrace {
+	var st StackTrace
+	for _, pc := range pcs {
+		frames := runtime.CallersFrames([]uintptr{pc})
+		for {
+			frame, more := frames.Next()
+			frameCache.Store(frame.PC, expandedFrame{
+				Function: frame.Function,
+				File:     frame.File,
+				Line:     frame.Line,
+				Entry:    frame.Entry,
+			})
+			st = append(st, Frame(frame.PC+1))
+			if !more {
+				break
+			}
+		}
 	}
-	return f
+	return st
 }
 
 // callers returns a stack trace of program counters starting from the caller's frame,
@@ -174,8 +427,77 @@ func callers(skip int) *stack {
 	const depth = 32
 	var pcs [depth]uintptr
 	n := runtime.Callers(skip+3, pcs[:])
-	var st stack = pcs[0:n]
-	return &st
+	st := &stack{pcs: pcs[:n]}
+	if liveGoroutineOrigins.Load() > 0 {
+		if origin, ok := goroutineOrigin(); ok {
+			st.origin = origin
+		}
+	}
+	return st
+}
+
+// goroutineOrigins holds the launching stack for goroutines started via Go,
+// keyed by the started goroutine's own id. callers() consults this so errors
+// created inside such a goroutine still carry the stack of whatever spawned
+// it, even though runtime.Callers can't itself see past the goroutine's
+// entry point.
+var goroutineOrigins sync.Map // map[uint64][]uintptr
+
+// liveGoroutineOrigins counts the goroutines currently registered in
+// goroutineOrigins. Go is opt-in, and the overwhelming majority of processes
+// never call it, so callers() checks this cheap counter before paying for
+// goroutineID's runtime.Stack call on every single error created — otherwise
+// every New/Wrap/WithStack would tax itself for a feature it never uses.
+var liveGoroutineOrigins atomic.Int64
+
+// goroutineOrigin returns the launching stack registered for the calling
+// goroutine, if it was started via Go.
+func goroutineOrigin() ([]uintptr, bool) {
+	v, ok := goroutineOrigins.Load(goroutineID())
+	if !ok {
+		return nil, false
+	}
+	return v.([]uintptr), true
+}
+
+// goroutineID parses the calling goroutine's id out of the header runtime.Stack
+// writes ("goroutine 37 [running]: ..."). There's no supported way to get this
+// id, but the header format has been stable for many Go releases, and this is
+// only ever used to key the goroutineOrigins map for the lifetime of a single
+// goroutine.
+func goroutineID() uint64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	b := bytes.TrimPrefix(buf[:n], []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
+
+// Go starts fn in a new goroutine, first snapshotting the caller's stack so
+// that any error created inside fn carries both its own stack and the stack
+// of the goroutine that launched it. callers() picks up the launching stack
+// automatically via goroutineOrigin, and the error's %+v output prints it
+// under a "created by goroutine at:" section, mirroring how the runtime
+// itself prints a goroutine's creator in a panic. StackTrace() and
+// StackTrace.Format do not include the launching stack.
+//
+// The registration is removed once fn returns, so there's nothing for
+// callers to clean up; this only leaks if fn never returns.
+func Go(fn func()) {
+	parent := callers(0).pcs
+	go func() {
+		id := goroutineID()
+		goroutineOrigins.Store(id, parent)
+		liveGoroutineOrigins.Add(1)
+		defer func() {
+			goroutineOrigins.Delete(id)
+			liveGoroutineOrigins.Add(-1)
+		}()
+		fn()
+	}()
 }
 
 // funcname removes the path prefix component of a function's name reported by func.Name().
@@ -189,40 +511,58 @@ func funcname(name string) string {
 // ancestorOfCause returns true if the caller looks to be an ancestor of the given stack
 // trace. We check this by seeing whether our stack prefix-matches the cause stack, which
 // should imply the error was generated directly from our goroutine.
+//
+// This operates on the raw, untrimmed program counters in ourStack rather than going
+// through (*stack).StackTrace(), so a globally installed SetStackTrimmer does not alter
+// our side of the comparison. causeStack is compared exactly as passed in: if it came
+// from a trimmed StackTrace(), the trimmed frames are missing from it.
 func ancestorOfCause(ourStack *stack, causeStack StackTrace) bool {
-	// Stack traces are ordered such that the deepest frame is first. We'll want to check
-	// for prefix matching in reverse.
-	//
-	// As an example, imagine we have a prefix-matching stack for ourselves:
-	// [
-	//   "github.com/onsi/ginkgo/internal/leafnodes.(*runner).runSync",
-	//   "github.com/incident-io/core/server/pkg/errors_test.TestSuite",
-	//   "testing.tRunner",
-	//   "runtime.goexit"
-	// ]
-	//
-	// We'll want to compare this against an error cause that will have happened further
-	// down the stack. An example stack trace from such an error might be:
-	// [
-	//   "github.com/incident-io/core/server/pkg/errors.New",
-	//   "github.com/incident-io/core/server/pkg/errors_test.glob..func1.2.2.2.1",
-	//   "github.com/onsi/ginkgo/internal/leafnodes.(*runner).runSync",
-	//   "github.com/incident-io/core/server/pkg/errors_test.TestSuite",
-	//   "testing.tRunner",
-	//   "runtime.goexit"
-	// ]
-	//
-	// They prefix match, but we'll have to handle the match carefully as we need to match
-	// from back to forward.
-
-	// We can't possibly prefix match if our stack is larger than the cause stack.
-	if len(*ourStack) > len(causeStack) {
+	our := make(StackTrace, len(ourStack.pcs))
+	for i, pc := range ourStack.pcs {
+		our[i] = Frame(pc)
+	}
+	return IsAncestor(our, causeStack)
+}
+
+// IsAncestor returns true if parent looks to be an ancestor of child: every frame of
+// parent is a program-counter-for-program-counter match for the frames at the bottom of
+// child's stack, which should imply child was generated directly from parent's goroutine.
+//
+// Stack traces are ordered such that the deepest frame is first, so we check for
+// prefix-matching in reverse.
+//
+// As an example, imagine we have a prefix-matching stack for ourselves:
+//
+//	[
+//	  "github.com/onsi/ginkgo/internal/leafnodes.(*runner).runSync",
+//	  "github.com/incident-io/core/server/pkg/errors_test.TestSuite",
+//	  "testing.tRunner",
+//	  "runtime.goexit"
+//	]
+//
+// We'll want to compare this against an error cause that will have happened further
+// down the stack. An example stack trace from such an error might be:
+//
+//	[
+//	  "github.com/incident-io/core/server/pkg/errors.New",
+//	  "github.com/incident-io/core/server/pkg/errors_test.glob..func1.2.2.2.1",
+//	  "github.com/onsi/ginkgo/internal/leafnodes.(*runner).runSync",
+//	  "github.com/incident-io/core/server/pkg/errors_test.TestSuite",
+//	  "testing.tRunner",
+//	  "runtime.goexit"
+//	]
+//
+// They prefix match, but we have to handle the match carefully as we need to match from
+// back to forward.
+func IsAncestor(parent, child StackTrace) bool {
+	// We can't possibly prefix match if parent's stack is larger than child's.
+	if len(parent) > len(child) {
 		return false
 	}
 
 	// We know the sizes are compatible, so compare program counters from back to front.
-	for idx := 0; idx < len(*ourStack); idx++ {
-		if (*ourStack)[len(*ourStack)-1] != (uintptr)(causeStack[len(causeStack)-1]) {
+	for idx := 0; idx < len(parent); idx++ {
+		if parent[len(parent)-1-idx] != child[len(child)-1-idx] {
 			return false
 		}
 	}
@@ -230,3 +570,25 @@ func ancestorOfCause(ourStack *stack, causeStack StackTrace) bool {
 	// All comparisons checked out, these stacks match.
 	return true
 }
+
+// CommonSuffix returns the shared tail of a and b: the longest run of frames that match
+// when compared from the outermost (oldest) frame inward. Wrapping an error repeatedly
+// across goroutine boundaries tends to pick up the same ancestor frames each time;
+// collapsing that shared tail when printing a wrapped error lets it show only the delta
+// between the wrap site's stack and the cause's, similar to how Java elides repeated
+// frames with "... N more".
+func CommonSuffix(a, b StackTrace) StackTrace {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+
+	idx := 0
+	for idx < n && a[len(a)-1-idx] == b[len(b)-1-idx] {
+		idx++
+	}
+	if idx == 0 {
+		return nil
+	}
+	return a[len(a)-idx:]
+}
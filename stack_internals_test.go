@@ -0,0 +1,108 @@
+package errors
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestExpandPCResolvesMetadata checks expandPC against runtime.CallersFrames
+// directly, independent of frameCache, and that it leaves the cache primed
+// for the pc it just resolved.
+func TestExpandPCResolvesMetadata(t *testing.T) {
+	var pcs [1]uintptr
+	n := runtime.Callers(1, pcs[:])
+	if n == 0 {
+		t.Fatal("runtime.Callers returned no frames")
+	}
+	pc := pcs[0]
+
+	frames := runtime.CallersFrames(pcs[:n])
+	want, _ := frames.Next()
+
+	got := expandPC(pc)
+	if got.Function != want.Function || got.File != want.File || got.Line != want.Line {
+		t.Errorf("expandPC(pc) = %+v, want {Function:%s File:%s Line:%d}", got, want.Function, want.File, want.Line)
+	}
+	if !strings.Contains(got.Function, "TestExpandPCResolvesMetadata") {
+		t.Errorf("expandPC(pc).Function = %q, want it to contain the calling test's name", got.Function)
+	}
+
+	cached, ok := frameCache.Load(pc)
+	if !ok {
+		t.Fatal("expandPC did not populate frameCache for the pc it resolved")
+	}
+	if cached.(expandedFrame) != got {
+		t.Errorf("frameCache entry = %+v, want %+v", cached, got)
+	}
+}
+
+// TestExpandPCCacheHit exercises the cached path: once frameCache already
+// holds an (possibly stale) entry for a pc, expandPC must return it rather
+// than re-resolving via runtime.CallersFrames.
+func TestExpandPCCacheHit(t *testing.T) {
+	const fakePC = ^uintptr(0) // guaranteed not to collide with a real pc
+	sentinel := expandedFrame{Function: "sentinel.Func", File: "sentinel.go", Line: 42}
+	frameCache.Store(fakePC, sentinel)
+	defer frameCache.Delete(fakePC)
+
+	if got := expandPC(fakePC); got != sentinel {
+		t.Errorf("expandPC(fakePC) = %+v, want cached sentinel %+v", got, sentinel)
+	}
+}
+
+// TestExpandStackResolvesEveryFrame captures a real stack and checks that
+// expandStack resolves every raw program counter to at least one Frame with
+// known metadata, and that it back-fills frameCache for each one (a single
+// pc can unfold into more than one Frame when the compiler inlined a call
+// into that return address).
+func TestExpandStackResolvesEveryFrame(t *testing.T) {
+	// callers' skip+3 convention assumes an intermediate wrapper like New()
+	// between the caller and callers() itself; called directly from this
+	// test, skip must be -1 to land on this function's own frame.
+	s := callers(-1)
+	if len(s.pcs) == 0 {
+		t.Fatal("callers(-1) captured no program counters")
+	}
+
+	st := expandStack(s.pcs)
+	if len(st) < len(s.pcs) {
+		t.Fatalf("expandStack returned %d frames for %d program counters, want at least as many (inlining only adds frames)", len(st), len(s.pcs))
+	}
+
+	found := false
+	for _, f := range st {
+		// Checked before f.name(), which would itself fill frameCache via expandPC.
+		if _, ok := frameCache.Load(f.pc()); !ok {
+			t.Errorf("expandStack did not prime frameCache for frame %s", f.name())
+		}
+		if f.name() == "unknown" {
+			t.Errorf("expandStack produced a frame with unresolved metadata: %+v", f)
+		}
+		if strings.Contains(f.name(), "TestExpandStackResolvesEveryFrame") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expandStack(st) = %v, want a frame naming the calling test", st)
+	}
+}
+
+// TestExpandStackAgreesWithExpandPC checks that, for every frame expandStack
+// produces, expandPC on that frame's own pc returns the same metadata the
+// Frame's name, file and line accessors report; both read the frameCache
+// entry expandStack stored for that pc.
+func TestExpandStackAgreesWithExpandPC(t *testing.T) {
+	s := callers(-1)
+	st := expandStack(s.pcs)
+
+	for _, f := range st {
+		if got, want := expandPC(f.pc()), (expandedFrame{
+			Function: f.name(),
+			File:     f.file(),
+			Line:     f.line(),
+		}); got.Function != want.Function || got.File != want.File || got.Line != want.Line {
+			t.Errorf("expandPC(%d) = %+v, want %+v", f.pc(), got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package errors
+
+import "testing"
+
+func TestIsAncestor(t *testing.T) {
+	tests := []struct {
+		name          string
+		parent, child StackTrace
+		want          bool
+	}{
+		{
+			name:   "parent is a proper suffix of child",
+			parent: StackTrace{3, 2, 1},
+			child:  StackTrace{5, 4, 3, 2, 1},
+			want:   true,
+		},
+		{
+			name:   "parent equals child",
+			parent: StackTrace{3, 2, 1},
+			child:  StackTrace{3, 2, 1},
+			want:   true,
+		},
+		{
+			name:   "parent longer than child can never match",
+			parent: StackTrace{5, 4, 3, 2, 1},
+			child:  StackTrace{3, 2, 1},
+			want:   false,
+		},
+		{
+			name: "frames differ only away from the shared tail",
+			// Regression for the original bug, which indexed with idx but
+			// always compared the last element, so as long as the very
+			// last frame matched it reported true regardless of the rest
+			// of the stack.
+			parent: StackTrace{9, 8, 1},
+			child:  StackTrace{9, 4, 3, 2, 1},
+			want:   false,
+		},
+		{
+			name:   "no shared tail at all",
+			parent: StackTrace{9, 8, 7},
+			child:  StackTrace{6, 5, 4},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsAncestor(tt.parent, tt.child); got != tt.want {
+				t.Errorf("IsAncestor(%v, %v) = %v, want %v", tt.parent, tt.child, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommonSuffix(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b StackTrace
+		want StackTrace
+	}{
+		{
+			name: "shared tail",
+			a:    StackTrace{5, 4, 3, 2, 1},
+			b:    StackTrace{9, 8, 3, 2, 1},
+			want: StackTrace{3, 2, 1},
+		},
+		{
+			name: "identical stacks",
+			a:    StackTrace{3, 2, 1},
+			b:    StackTrace{3, 2, 1},
+			want: StackTrace{3, 2, 1},
+		},
+		{
+			name: "no shared tail",
+			a:    StackTrace{3, 2, 1},
+			b:    StackTrace{6, 5, 4},
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CommonSuffix(tt.a, tt.b)
+			if len(got) != len(tt.want) {
+				t.Fatalf("CommonSuffix(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("CommonSuffix(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package errors
+
+import (
+	"fmt"
+	"testing"
+)
+
+// verbWidget exists solely so verbFrame below captures a stack whose
+// innermost frame is a pointer-receiver method, the case splitFuncName's
+// dot-splitting has to get right: "pkg.(*verbWidget).capture" must split
+// into the package path and "(*verbWidget).capture", not mangle the
+// receiver's parenthesised type.
+type verbWidget struct{}
+
+func (w *verbWidget) capture() error {
+	return New("boom")
+}
+
+func verbFrame(t *testing.T) Frame {
+	t.Helper()
+	err := (&verbWidget{}).capture()
+	st, ok := err.(stackTracer)
+	if !ok {
+		t.Fatal("New's result does not implement stackTracer")
+	}
+	trace := st.StackTrace()
+	if len(trace) == 0 {
+		t.Fatal("captured an empty stack trace")
+	}
+	return trace[0]
+}
+
+func TestFrameFormatReceiverMethodName(t *testing.T) {
+	f := verbFrame(t)
+
+	if got, want := fmt.Sprintf("%n", f), "(*verbWidget).capture"; got != want {
+		t.Errorf("%%n = %q, want %q", got, want)
+	}
+	if got, want := fmt.Sprintf("%+n", f), "github.com/hearSmart/go-errors.(*verbWidget).capture"; got != want {
+		t.Errorf("%%+n = %q, want %q", got, want)
+	}
+}
+
+func TestFrameFormatPackageVerb(t *testing.T) {
+	f := verbFrame(t)
+
+	if got, want := fmt.Sprintf("%k", f), "go-errors"; got != want {
+		t.Errorf("%%k = %q, want %q", got, want)
+	}
+	if got, want := fmt.Sprintf("%+k", f), "github.com/hearSmart/go-errors"; got != want {
+		t.Errorf("%%+k = %q, want %q", got, want)
+	}
+}
+
+func TestSplitFuncName(t *testing.T) {
+	tests := []struct {
+		name    string
+		pkg, fn string
+	}{
+		{"github.com/hearSmart/go-errors.New", "github.com/hearSmart/go-errors", "New"},
+		{"github.com/hearSmart/go-errors.(*verbWidget).capture", "github.com/hearSmart/go-errors", "(*verbWidget).capture"},
+		{"main.main", "main", "main"},
+		{"main.(*T).Method", "main", "(*T).Method"},
+		{"no-dot-at-all", "no-dot-at-all", ""},
+	}
+	for _, tt := range tests {
+		pkg, fn := splitFuncName(tt.name)
+		if pkg != tt.pkg || fn != tt.fn {
+			t.Errorf("splitFuncName(%q) = (%q, %q), want (%q, %q)", tt.name, pkg, fn, tt.pkg, tt.fn)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package errors
+
+import "testing"
+
+func TestTrimRuntime(t *testing.T) {
+	st := New("boom").(stackTracer).StackTrace()
+
+	trimmed := st.TrimRuntime()
+	if len(trimmed) == 0 || len(trimmed) >= len(st) {
+		t.Fatalf("TrimRuntime() = %d frames, want fewer than the original %d (test runs under testing.tRunner/runtime.goexit)", len(trimmed), len(st))
+	}
+	for _, f := range trimmed {
+		if isRuntimeBoundary(f) {
+			t.Errorf("TrimRuntime() left a runtime/testing boundary frame in the result: %s", f.name())
+		}
+	}
+	for _, f := range st[len(trimmed):] {
+		if !isRuntimeBoundary(f) {
+			t.Errorf("TrimRuntime() dropped a non-boundary frame: %s", f.name())
+		}
+	}
+}
+
+func TestTrimBelow(t *testing.T) {
+	st := StackTrace{5, 4, 3, 2, 1}
+
+	got := st.TrimBelow(func(f Frame) bool { return f == 3 })
+	want := StackTrace{5, 4, 3}
+	if !stackTraceEqual(got, want) {
+		t.Errorf("TrimBelow(==3) = %v, want %v", got, want)
+	}
+
+	if got := st.TrimBelow(func(Frame) bool { return false }); !stackTraceEqual(got, st) {
+		t.Errorf("TrimBelow with no match = %v, want original %v unchanged", got, st)
+	}
+}
+
+func TestTrimAbove(t *testing.T) {
+	st := StackTrace{5, 4, 3, 2, 1}
+
+	got := st.TrimAbove(func(f Frame) bool { return f == 3 })
+	want := StackTrace{3, 2, 1}
+	if !stackTraceEqual(got, want) {
+		t.Errorf("TrimAbove(==3) = %v, want %v", got, want)
+	}
+
+	if got := st.TrimAbove(func(Frame) bool { return false }); !stackTraceEqual(got, st) {
+		t.Errorf("TrimAbove with no match = %v, want original %v unchanged", got, st)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	st := StackTrace{5, 4, 3, 2, 1}
+
+	got := st.Filter(func(f Frame) bool { return f%2 == 0 })
+	want := StackTrace{4, 2}
+	if !stackTraceEqual(got, want) {
+		t.Errorf("Filter(even) = %v, want %v", got, want)
+	}
+}
+
+// TestTrimDoesNotAliasOriginal is a regression test: TrimRuntime, TrimBelow,
+// and TrimAbove used to reslice the receiver instead of copying it, so
+// appending to or writing into the trimmed result could silently overwrite
+// frames in the original, untrimmed StackTrace.
+func TestTrimDoesNotAliasOriginal(t *testing.T) {
+	original := StackTrace{5, 4, 3, 2, 1}
+	originalCopy := append(StackTrace(nil), original...)
+
+	below := original.TrimBelow(func(f Frame) bool { return f == 3 })
+	below = append(below, 99) // stays within a reslice's spare capacity, i.e. original[3]
+	if !stackTraceEqual(original, originalCopy) {
+		t.Errorf("appending to TrimBelow's result mutated the original: got %v, want %v", original, originalCopy)
+	}
+
+	above := original.TrimAbove(func(f Frame) bool { return f == 3 })
+	above[0] = 99 // a reslice would share this element with original[2]
+	if !stackTraceEqual(original, originalCopy) {
+		t.Errorf("writing to TrimAbove's result mutated the original: got %v, want %v", original, originalCopy)
+	}
+
+	runtimeTrace := New("boom").(stackTracer).StackTrace()
+	runtimeCopy := append(StackTrace(nil), runtimeTrace...)
+	trimmed := runtimeTrace.TrimRuntime()
+	trimmed = append(trimmed, 99) // stays within a reslice's spare capacity
+	if !stackTraceEqual(runtimeTrace, runtimeCopy) {
+		t.Errorf("appending to TrimRuntime's result mutated the original: got %v, want %v", runtimeTrace, runtimeCopy)
+	}
+}
+
+func TestSetStackTrimmer(t *testing.T) {
+	defer SetStackTrimmer(nil)
+
+	SetStackTrimmer(func(st StackTrace) StackTrace {
+		return st.TrimRuntime()
+	})
+
+	st := New("boom").(stackTracer).StackTrace()
+	for _, f := range st {
+		if isRuntimeBoundary(f) {
+			t.Errorf("globally installed trimmer did not strip boundary frame %s from a freshly captured stack", f.name())
+		}
+	}
+
+	SetStackTrimmer(nil)
+	st = New("boom").(stackTracer).StackTrace()
+	sawBoundary := false
+	for _, f := range st {
+		if isRuntimeBoundary(f) {
+			sawBoundary = true
+		}
+	}
+	if !sawBoundary {
+		t.Errorf("removing the trimmer (SetStackTrimmer(nil)) should restore the untrimmed stack")
+	}
+}
+
+func stackTraceEqual(a, b StackTrace) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}